@@ -7,10 +7,9 @@ import (
 	"path/filepath"
 	"strconv"
 	"sync"
-	"time"
 
-	"github.com/btcsuite/goleveldb/leveldb"
 	"github.com/wakiyamap/monad/chaincfg"
+	"github.com/wakiyamap/monad/database/driver"
 	"github.com/wakiyamap/monad/wire"
 	"github.com/wakiyamap/monautil"
 )
@@ -25,6 +24,7 @@ const (
 	// AlertKeyDbNamePrefix is the prefix for the monad volatilecheckpoint database.
 	alertKeyDbNamePrefix = "alertkey"
 
+	// defaultDbType is used when monad.conf does not set dbtype.
 	defaultDbType = "leveldb"
 )
 
@@ -32,30 +32,134 @@ var (
 	monadHomeDir      = monautil.AppDataDir("monad", false)
 	defaultDataDir    = filepath.Join(monadHomeDir, "data")
 	defaultConfigFile = filepath.Join(monadHomeDir, "monad.conf")
-	activeNetParams   = &chaincfg.MainNetParams
 
-	// Default global config.
-	cfg = &config{
-		DataDir: filepath.Join(monadHomeDir, "data"),
-	}
+	globalCfgMu  sync.Mutex
+	globalCfg    Config
+	globalCfgSet bool
 )
 
 type UserCheckpoint struct {
-	Ucdb *leveldb.DB
+	Ucdb driver.DB
+	cfg  Config
+}
+
+// Config carries everything a store needs to resolve its on-disk path and
+// backend. Building one never reads monad.conf or parses the command line,
+// which is what makes NewUserCheckpoint (and friends) safe to call from a
+// library embedder or a test with its own flag set.
+type Config struct {
+	// DataDir is the monad data directory. Empty means defaultDataDir.
+	DataDir string
+
+	// Net selects the network-specific subdirectory and chain params.
+	// The zero value resolves to chaincfg.MainNetParams.
+	Net wire.BitcoinNet
+
+	// DbType selects the driver.DB backend. Empty means defaultDbType.
+	DbType string
 }
 
-// config defines the global configuration options.
-type config struct {
+// iniConfig mirrors monad.conf and the command line for loadConfig's use.
+// It is kept separate from Config so building a Config never depends on
+// go-flags or the filesystem.
+type iniConfig struct {
 	DataDir        string `short:"b" long:"datadir" description:"Location of the monad data directory"`
 	ConfigFile     string `short:"C" long:"configfile" description:"Path to configuration file"`
 	TestNet4       bool   `long:"testnet" description:"Use the test network"`
 	RegressionTest bool   `long:"regtest" description:"Use the regression test network"`
 	SimNet         bool   `long:"simnet" description:"Use the simulation test network"`
+	DbType         string `long:"dbtype" description:"Database backend to use (leveldb, boltdb, memory)"`
 }
 
 var instance *UserCheckpoint
 var once sync.Once
 
+// SetGlobalConfig overrides the Config that GetUserCheckpointDbInstance and
+// its siblings build their singleton from the first time each is called.
+// It must be called before any of those functions for the override to take
+// effect; tests and embedders that don't want monad.conf parsed for them
+// should call it with an explicit Config, typically one with
+// DbType: "memory".
+func SetGlobalConfig(cfg Config) {
+	globalCfgMu.Lock()
+	defer globalCfgMu.Unlock()
+	globalCfg = cfg
+	globalCfgSet = true
+}
+
+// defaultGlobalConfig returns the Config the Get*DbInstance functions fall
+// back to when SetGlobalConfig hasn't been called, parsing monad.conf and
+// the command line exactly once.
+func defaultGlobalConfig() Config {
+	globalCfgMu.Lock()
+	defer globalCfgMu.Unlock()
+	if globalCfgSet {
+		return globalCfg
+	}
+
+	ini, _, err := loadConfig()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	net := chaincfg.MainNetParams.Net
+	if ini.TestNet4 {
+		net = chaincfg.TestNet4Params.Net
+	}
+	if ini.RegressionTest {
+		net = chaincfg.RegressionNetParams.Net
+	}
+	if ini.SimNet {
+		net = chaincfg.SimNetParams.Net
+	}
+
+	globalCfg = Config{DataDir: ini.DataDir, Net: net, DbType: ini.DbType}
+	globalCfgSet = true
+	return globalCfg
+}
+
+// paramsForNet maps a Config's Net back to the matching chaincfg.Params,
+// defaulting to mainnet for the zero value or an unrecognized network.
+func paramsForNet(net wire.BitcoinNet) *chaincfg.Params {
+	switch net {
+	case chaincfg.TestNet4Params.Net:
+		return &chaincfg.TestNet4Params
+	case chaincfg.RegressionNetParams.Net:
+		return &chaincfg.RegressionNetParams
+	case chaincfg.SimNetParams.Net:
+		return &chaincfg.SimNetParams
+	default:
+		return &chaincfg.MainNetParams
+	}
+}
+
+// dbTypeOrDefault returns cfg.DbType, falling back to defaultDbType.
+func dbTypeOrDefault(cfg Config) string {
+	if cfg.DbType == "" {
+		return defaultDbType
+	}
+	return cfg.DbType
+}
+
+// resolveDbPath builds the on-disk path for a store identified by prefix
+// under cfg.
+func resolveDbPath(cfg Config, prefix string) string {
+	dataDir := cfg.DataDir
+	if dataDir == "" {
+		dataDir = defaultDataDir
+	}
+	dbName := prefix + "_" + dbTypeOrDefault(cfg)
+	return filepath.Join(dataDir, netName(paramsForNet(cfg.Net)), dbName)
+}
+
+// ResolveDbPath builds the on-disk path for a store identified by prefix,
+// using the process-wide default Config (see SetGlobalConfig). It
+// centralizes the path logic that used to be duplicated across every
+// Get*DbPath function.
+func ResolveDbPath(prefix string) string {
+	return resolveDbPath(defaultGlobalConfig(), prefix)
+}
+
 // netName returns the name used when referring to a bitcoin network.  At the
 // time of writing, monad currently places blocks for testnet version 3 in the
 // data and log directory "testnet", which does not match the Name field of the
@@ -76,10 +180,11 @@ func netName(chainParams *chaincfg.Params) string {
 
 // loadConfig initializes and parses the config using a config file and command
 // line options.
-func loadConfig() (*config, []string, error) {
+func loadConfig() (*iniConfig, []string, error) {
 	// Default config.
-	cfg := config{
+	cfg := iniConfig{
 		ConfigFile: defaultConfigFile,
+		DbType:     defaultDbType,
 	}
 
 	// Load additional config from file.
@@ -109,9 +214,19 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	if cfg.DbType == "" {
+		cfg.DbType = defaultDbType
+	}
+
 	return &cfg, remainingArgs, nil
 }
 
+// NewUserCheckpoint builds a UserCheckpoint rooted at cfg. Call OpenDB
+// before using it.
+func NewUserCheckpoint(cfg Config) *UserCheckpoint {
+	return &UserCheckpoint{cfg: cfg}
+}
+
 // open usercheckpointDB. Basically it is called only at startup.
 func (uc *UserCheckpoint) OpenDB() error {
 	if uc.Ucdb != nil {
@@ -119,8 +234,7 @@ func (uc *UserCheckpoint) OpenDB() error {
 	}
 
 	var err error
-	dbpath := GetUserCheckpointDbPath()
-	uc.Ucdb, err = leveldb.OpenFile(dbpath, nil)
+	uc.Ucdb, err = driver.Open(dbTypeOrDefault(uc.cfg), resolveDbPath(uc.cfg, userCheckpointDbNamePrefix))
 	return err
 }
 
@@ -134,62 +248,51 @@ func (uc *UserCheckpoint) CloseDB() {
 }
 
 func (uc *UserCheckpoint) Add(height int64, hash string) {
-	_ = uc.Ucdb.Put([]byte(fmt.Sprintf("%020d", height)), []byte(hash), nil)
+	_ = uc.Ucdb.Put([]byte(fmt.Sprintf("%020d", height)), []byte(hash))
 }
 
 func (uc *UserCheckpoint) Delete(height int64) {
-	_ = uc.Ucdb.Delete([]byte(fmt.Sprintf("%020d", height)), nil)
+	_ = uc.Ucdb.Delete([]byte(fmt.Sprintf("%020d", height)))
 }
 
 func (uc *UserCheckpoint) GetMaxCheckpointHeight() (height int64) {
 	height = 0
-	iter := uc.Ucdb.NewIterator(nil, nil)
-	iter.Last()
+	iter := uc.Ucdb.Iterator(nil)
+	defer iter.Release()
 
-	if !iter.Valid() {
+	var lastKey []byte
+	for iter.Next() {
+		lastKey = iter.Key()
+	}
+	if lastKey == nil {
 		return height
 	}
 
-	height, _ = strconv.ParseInt(string(iter.Key()), 10, 64)
-	iter.Release()
+	height, _ = strconv.ParseInt(string(lastKey), 10, 64)
 	return height
 }
 
 func GetUserCheckpointDbInstance() *UserCheckpoint {
 	once.Do(func() {
-		time.Sleep(1 * time.Second)
-		instance = &UserCheckpoint{nil}
+		instance = NewUserCheckpoint(defaultGlobalConfig())
 	})
 	return instance
 }
 
-func GetUserCheckpointDbPath() (dbPath string) {
-	cfg, _, err := loadConfig()
-	if err != nil {
-		os.Exit(1)
-	}
-	if cfg.TestNet4 {
-		activeNetParams = &chaincfg.TestNet4Params
-	}
-	if cfg.RegressionTest {
-		activeNetParams = &chaincfg.RegressionNetParams
-	}
-	if cfg.SimNet {
-		activeNetParams = &chaincfg.SimNetParams
-	}
-	dbName := userCheckpointDbNamePrefix + "_" + defaultDbType
-	dbPath = filepath.Join(defaultDataDir, netName(activeNetParams), dbName)
-
-	return dbPath
-}
-
 type VolatileCheckpoint struct {
-	Vcdb *leveldb.DB
+	Vcdb driver.DB
+	cfg  Config
 }
 
 var vinstance *VolatileCheckpoint
 var vonce sync.Once
 
+// NewVolatileCheckpoint builds a VolatileCheckpoint rooted at cfg. Call
+// OpenDB before using it.
+func NewVolatileCheckpoint(cfg Config) *VolatileCheckpoint {
+	return &VolatileCheckpoint{cfg: cfg}
+}
+
 // open volatilecheckpointDB. Basically it is called only at startup.
 func (vc *VolatileCheckpoint) OpenDB() error {
 	if vc.Vcdb != nil {
@@ -197,8 +300,7 @@ func (vc *VolatileCheckpoint) OpenDB() error {
 	}
 
 	var err error
-	dbpath := GetVolatileCheckpointDbPath()
-	vc.Vcdb, err = leveldb.OpenFile(dbpath, nil)
+	vc.Vcdb, err = driver.Open(dbTypeOrDefault(vc.cfg), resolveDbPath(vc.cfg, volatileCheckpointDbNamePrefix))
 	return err
 }
 
@@ -212,62 +314,46 @@ func (vc *VolatileCheckpoint) CloseDB() {
 }
 
 func (vc *VolatileCheckpoint) Set(height int64, hash string) {
-	_ = vc.Vcdb.Put([]byte(fmt.Sprintf("%020d", height)), []byte(hash), nil)
+	_ = vc.Vcdb.Put([]byte(fmt.Sprintf("%020d", height)), []byte(hash))
 }
 
 func (vc *VolatileCheckpoint) ClearDB() {
-	iter := vc.Vcdb.NewIterator(nil, nil)
+	iter := vc.Vcdb.Iterator(nil)
+	defer iter.Release()
 	for iter.Next() {
-		err := vc.Vcdb.Delete([]byte(string(iter.Key())), nil)
+		err := vc.Vcdb.Delete(iter.Key())
 		if err != nil {
 			break
 		}
 	}
-	iter.Release()
 }
 
 func GetVolatileCheckpointDbInstance() *VolatileCheckpoint {
 	vonce.Do(func() {
-		time.Sleep(1 * time.Second)
-		vinstance = &VolatileCheckpoint{nil}
+		vinstance = NewVolatileCheckpoint(defaultGlobalConfig())
 	})
 	return vinstance
 }
 
-func GetVolatileCheckpointDbPath() (dbPath string) {
-	cfg, _, err := loadConfig()
-	if err != nil {
-		os.Exit(1)
-	}
-	if cfg.TestNet4 {
-		activeNetParams = &chaincfg.TestNet4Params
-	}
-	if cfg.RegressionTest {
-		activeNetParams = &chaincfg.RegressionNetParams
-	}
-	if cfg.SimNet {
-		activeNetParams = &chaincfg.SimNetParams
-	}
-	dbName := volatileCheckpointDbNamePrefix + "_" + defaultDbType
-	dbPath = filepath.Join(defaultDataDir, netName(activeNetParams), dbName)
-
-	return dbPath
-}
-
 type AlertKey struct {
-	Akdb *leveldb.DB
+	Akdb driver.DB
+	cfg  Config
 }
 
 var ainstance *AlertKey
 var aonce sync.Once
 
+// NewAlertKey builds an AlertKey rooted at cfg. Call OpenDB before using it.
+func NewAlertKey(cfg Config) *AlertKey {
+	return &AlertKey{cfg: cfg}
+}
+
 func (ak *AlertKey) OpenDB() error {
 	if ak.Akdb != nil {
 		return nil
 	}
 	var err error
-	dbpath := GetAlertKeyDbPath()
-	ak.Akdb, err = leveldb.OpenFile(dbpath, nil)
+	ak.Akdb, err = driver.Open(dbTypeOrDefault(ak.cfg), resolveDbPath(ak.cfg, alertKeyDbNamePrefix))
 	return err
 }
 
@@ -281,20 +367,22 @@ func (ak *AlertKey) CloseDB() {
 
 // Alertkey is disabled when you came here.irreversible.
 func (ak *AlertKey) Set(key string) {
-	_ = ak.Akdb.Put([]byte(key), []byte("true"), nil)
+	_ = ak.Akdb.Put([]byte(key), []byte("true"))
 }
 
 // Add alertkey if it is not in database.
 // Returns true if both of the public keys alertkey are OK.
 func (ak *AlertKey) IsValid() bool {
-	d1, err := ak.Akdb.Get(activeNetParams.AlertPubMainKey, nil)
+	netParams := paramsForNet(ak.cfg.Net)
+
+	d1, err := ak.Akdb.Get(netParams.AlertPubMainKey)
 	if err != nil {
-		_ = ak.Akdb.Put(activeNetParams.AlertPubMainKey, []byte("false"), nil)
+		_ = ak.Akdb.Put(netParams.AlertPubMainKey, []byte("false"))
 	}
 
-	d2, err := ak.Akdb.Get(activeNetParams.AlertPubSubKey, nil)
+	d2, err := ak.Akdb.Get(netParams.AlertPubSubKey)
 	if err != nil {
-		_ = ak.Akdb.Put(activeNetParams.AlertPubSubKey, []byte("false"), nil)
+		_ = ak.Akdb.Put(netParams.AlertPubSubKey, []byte("false"))
 	}
 
 	if string(d1) == "false" && string(d2) == "false" {
@@ -305,27 +393,7 @@ func (ak *AlertKey) IsValid() bool {
 
 func GetAlertKeyDbInstance() *AlertKey {
 	aonce.Do(func() {
-		time.Sleep(1 * time.Second)
-		ainstance = &AlertKey{nil}
+		ainstance = NewAlertKey(defaultGlobalConfig())
 	})
 	return ainstance
 }
-
-func GetAlertKeyDbPath() (dbPath string) {
-	cfg, _, err := loadConfig()
-	if err != nil {
-		os.Exit(1)
-	}
-	if cfg.TestNet4 {
-		activeNetParams = &chaincfg.TestNet4Params
-	}
-	if cfg.RegressionTest {
-		activeNetParams = &chaincfg.RegressionNetParams
-	}
-	if cfg.SimNet {
-		activeNetParams = &chaincfg.SimNetParams
-	}
-	dbName := alertKeyDbNamePrefix + "_" + defaultDbType
-	dbPath = filepath.Join(defaultDataDir, netName(activeNetParams), dbName)
-	return dbPath
-}
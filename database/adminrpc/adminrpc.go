@@ -0,0 +1,196 @@
+// Package adminrpc exposes a small JSON-RPC admin API over HTTP for managing
+// the user checkpoint, volatile checkpoint, alert key, and denylist stores.
+// Start reads the server's settings from monad.conf and serves the API;
+// nothing in monad's own startup calls it.
+package adminrpc
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	flags "github.com/jessevdk/go-flags"
+
+	"github.com/wakiyamap/monad/database"
+	"github.com/wakiyamap/monautil"
+)
+
+// DefaultListen is used when Config.Listen is empty.
+const DefaultListen = "127.0.0.1:18667"
+
+// defaultConfigFile mirrors the database package's defaultConfigFile, so
+// loadConfig reads the same monad.conf an operator already maintains for
+// the rest of the daemon's config.
+var defaultConfigFile = filepath.Join(monautil.AppDataDir("monad", false), "monad.conf")
+
+// Config controls how the admin server binds and authenticates. It follows
+// the same go-flags + INI idiom the checkpoint package's loadConfig uses, so
+// it can be embedded into monad.conf alongside the rest of the daemon config;
+// loadConfig is what actually parses it, for Start to use.
+type Config struct {
+	Listen   string `long:"adminrpclisten" description:"Host:port the admin JSON-RPC server listens on"`
+	User     string `long:"adminrpcuser" description:"Username for admin JSON-RPC basic auth"`
+	Password string `long:"adminrpcpass" description:"Password for admin JSON-RPC basic auth"`
+}
+
+// loadConfig parses the adminrpc options out of monad.conf and the command
+// line, mirroring the checkpoint package's loadConfig. Config already
+// carries its own go-flags tags, so there's no separate ini-only type to
+// parse into the way database.loadConfig has iniConfig.
+func loadConfig() (*Config, []string, error) {
+	cfg := Config{Listen: DefaultListen}
+
+	parser := flags.NewParser(&cfg, flags.Default)
+	_ = flags.NewIniParser(parser).ParseFile(defaultConfigFile)
+	remainingArgs, err := parser.Parse()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.Listen == "" {
+		cfg.Listen = DefaultListen
+	}
+
+	return &cfg, remainingArgs, nil
+}
+
+// Server is the admin JSON-RPC+HTTP server. It wraps the four package-level
+// singletons from the database package.
+type Server struct {
+	cfg Config
+
+	uc *database.UserCheckpoint
+	vc *database.VolatileCheckpoint
+	ak *database.AlertKey
+	da *database.DenyAddress
+
+	methods map[string]func(params json.RawMessage) (interface{}, error)
+}
+
+// NewServer builds a Server bound to cfg, wired to the database package's
+// singleton stores. It opens all four stores before returning, so handlers
+// never call OpenDB themselves -- net/http serves each request on its own
+// goroutine, and OpenDB's nil check is only safe called from one goroutine
+// at a time.
+func NewServer(cfg Config) (*Server, error) {
+	if cfg.Listen == "" {
+		cfg.Listen = DefaultListen
+	}
+
+	s := &Server{
+		cfg: cfg,
+		uc:  database.GetUserCheckpointDbInstance(),
+		vc:  database.GetVolatileCheckpointDbInstance(),
+		ak:  database.GetAlertKeyDbInstance(),
+		da:  database.GetDenyAddressDbInstance(),
+	}
+	if err := s.uc.OpenDB(); err != nil {
+		return nil, fmt.Errorf("adminrpc: open usercheckpoint db: %v", err)
+	}
+	if err := s.vc.OpenDB(); err != nil {
+		return nil, fmt.Errorf("adminrpc: open volatilecheckpoint db: %v", err)
+	}
+	if err := s.ak.OpenDB(); err != nil {
+		return nil, fmt.Errorf("adminrpc: open alertkey db: %v", err)
+	}
+	if err := s.da.OpenDB(); err != nil {
+		return nil, fmt.Errorf("adminrpc: open denyaddress db: %v", err)
+	}
+
+	s.methods = map[string]func(json.RawMessage) (interface{}, error){
+		"usercheckpoint.add":       s.userCheckpointAdd,
+		"usercheckpoint.delete":    s.userCheckpointDelete,
+		"usercheckpoint.list":      s.userCheckpointList,
+		"usercheckpoint.max":       s.userCheckpointMax,
+		"volatilecheckpoint.set":   s.volatileCheckpointSet,
+		"volatilecheckpoint.clear": s.volatileCheckpointClear,
+		"alertkey.set":             s.alertKeySet,
+		"alertkey.isvalid":         s.alertKeyIsValid,
+		"denyaddress.add":          s.denyAddressAdd,
+		"denyaddress.list":         s.denyAddressList,
+		"denyaddress.remove":       s.denyAddressRemove,
+	}
+	return s, nil
+}
+
+// ListenAndServe binds cfg.Listen and serves the JSON-RPC API until the
+// listener errors or the process exits.
+func (s *Server) ListenAndServe() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handle)
+	return http.ListenAndServe(s.cfg.Listen, mux)
+}
+
+// Start parses monad.conf and the command line for admin RPC settings,
+// builds a Server from them, and serves until the listener errors or the
+// process exits. NewServer/ListenAndServe remain available separately for
+// an embedder that already has its own Config.
+func Start() error {
+	cfg, _, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	s, err := NewServer(*cfg)
+	if err != nil {
+		return err
+	}
+
+	return s.ListenAndServe()
+}
+
+// request is a single JSON-RPC call. id is echoed back verbatim in response.
+type request struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type response struct {
+	ID     json.RawMessage `json:"id"`
+	Result interface{}     `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.User != "" || s.cfg.Password != "" {
+		user, pass, ok := r.BasicAuth()
+		if !ok || !constantTimeEqual(user, s.cfg.User) || !constantTimeEqual(pass, s.cfg.Password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="monad admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	method, ok := s.methods[req.Method]
+	if !ok {
+		writeJSON(w, response{ID: req.ID, Error: fmt.Sprintf("unknown method %q", req.Method)})
+		return
+	}
+
+	result, err := method(req.Params)
+	if err != nil {
+		writeJSON(w, response{ID: req.ID, Error: err.Error()})
+		return
+	}
+	writeJSON(w, response{ID: req.ID, Result: result})
+}
+
+func writeJSON(w http.ResponseWriter, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// constantTimeEqual reports whether a and b are equal without leaking their
+// length of agreement through timing, unlike a plain == comparison.
+func constantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,104 @@
+package adminrpc
+
+import "encoding/json"
+
+type heightHashParams struct {
+	Height int64  `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+type heightParams struct {
+	Height int64 `json:"height"`
+}
+
+type rangeParams struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+type keyParams struct {
+	Key string `json:"key"`
+}
+
+type addressParams struct {
+	Address string `json:"address"`
+}
+
+func (s *Server) userCheckpointAdd(raw json.RawMessage) (interface{}, error) {
+	var p heightHashParams
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, err
+	}
+	s.uc.Add(p.Height, p.Hash)
+	return "ok", nil
+}
+
+func (s *Server) userCheckpointDelete(raw json.RawMessage) (interface{}, error) {
+	var p heightParams
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, err
+	}
+	s.uc.Delete(p.Height)
+	return "ok", nil
+}
+
+func (s *Server) userCheckpointList(raw json.RawMessage) (interface{}, error) {
+	var p rangeParams
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, err
+	}
+	return s.uc.List(p.From, p.To), nil
+}
+
+func (s *Server) userCheckpointMax(raw json.RawMessage) (interface{}, error) {
+	return s.uc.GetMaxCheckpointHeight(), nil
+}
+
+func (s *Server) volatileCheckpointSet(raw json.RawMessage) (interface{}, error) {
+	var p heightHashParams
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, err
+	}
+	s.vc.Set(p.Height, p.Hash)
+	return "ok", nil
+}
+
+func (s *Server) volatileCheckpointClear(raw json.RawMessage) (interface{}, error) {
+	s.vc.ClearDB()
+	return "ok", nil
+}
+
+func (s *Server) alertKeySet(raw json.RawMessage) (interface{}, error) {
+	var p keyParams
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, err
+	}
+	s.ak.Set(p.Key)
+	return "ok", nil
+}
+
+func (s *Server) alertKeyIsValid(raw json.RawMessage) (interface{}, error) {
+	return s.ak.IsValid(), nil
+}
+
+func (s *Server) denyAddressAdd(raw json.RawMessage) (interface{}, error) {
+	var p addressParams
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, err
+	}
+	s.da.Set(p.Address)
+	return "ok", nil
+}
+
+func (s *Server) denyAddressList(raw json.RawMessage) (interface{}, error) {
+	return s.da.List(), nil
+}
+
+func (s *Server) denyAddressRemove(raw json.RawMessage) (interface{}, error) {
+	var p addressParams
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, err
+	}
+	s.da.Remove(p.Address)
+	return "ok", nil
+}
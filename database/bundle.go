@@ -0,0 +1,191 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/wakiyamap/monad/btcec"
+	"github.com/wakiyamap/monad/chaincfg/chainhash"
+)
+
+// bundleMagic identifies a checkpoint bundle produced by ExportBundle.
+var bundleMagic = [4]byte{'M', 'C', 'K', 'P'}
+
+// bundleVersion is the only bundle format ExportBundle/ImportBundle
+// currently understand.
+const bundleVersion = 1
+
+// ExportBundle serializes every (height, hash) checkpoint this store holds
+// into a compact, signed bundle: the 4-byte magic, a version byte, a
+// varint entry count, then varint-height/length-prefixed-hash pairs,
+// followed by a length-prefixed ECDSA signature over everything before it.
+// Operators use this to ship a curated checkpoint set out-of-band (for
+// example, a fresh sync of an altcoin whose hard-coded checkpoints lag);
+// ImportBundle verifies the signature before merging.
+func (uc *UserCheckpoint) ExportBundle(w io.Writer, signingKey *btcec.PrivateKey) error {
+	entries := uc.List(0, 0)
+
+	heights := make([]int64, 0, len(entries))
+	for height := range entries {
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+
+	var body bytes.Buffer
+	body.Write(bundleMagic[:])
+	body.WriteByte(bundleVersion)
+	writeUvarint(&body, uint64(len(heights)))
+	for _, height := range heights {
+		hash := entries[height]
+		writeUvarint(&body, uint64(height))
+		writeUvarint(&body, uint64(len(hash)))
+		body.WriteString(hash)
+	}
+
+	digest := chainhash.DoubleHashB(body.Bytes())
+	sig, err := signingKey.Sign(digest)
+	if err != nil {
+		return fmt.Errorf("database: sign checkpoint bundle: %v", err)
+	}
+	sigBytes := sig.Serialize()
+	writeUvarint(&body, uint64(len(sigBytes)))
+	body.Write(sigBytes)
+
+	_, err = w.Write(body.Bytes())
+	return err
+}
+
+// ImportBundle reads a bundle produced by ExportBundle, verifies its
+// signature against one of trustedPubKeys, and merges its entries via a
+// single Tx so a bad or unverifiable bundle leaves the store untouched.
+// Entries already present (in the store, or earlier in the same bundle)
+// with a matching hash are skipped; entries that conflict with a different
+// hash at the same height are rejected.
+func (uc *UserCheckpoint) ImportBundle(r io.Reader, trustedPubKeys [][]byte) (added, skipped int, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(data) < len(bundleMagic)+1 {
+		return 0, 0, errors.New("database: checkpoint bundle too short")
+	}
+	if !bytes.Equal(data[:len(bundleMagic)], bundleMagic[:]) {
+		return 0, 0, errors.New("database: not a checkpoint bundle")
+	}
+	if data[len(bundleMagic)] != bundleVersion {
+		return 0, 0, fmt.Errorf("database: unsupported checkpoint bundle version %d", data[len(bundleMagic)])
+	}
+
+	buf := bytes.NewReader(data[len(bundleMagic)+1:])
+
+	count, err := binary.ReadUvarint(buf)
+	if err != nil {
+		return 0, 0, err
+	}
+	// A bundle is untrusted input at this point -- the signature isn't
+	// checked until after this loop. Every entry consumes at least one
+	// remaining byte, so a count, hashLen, or sigLen bigger than what's
+	// left in buf can only be a lie; reject it before it drives an
+	// allocation, rather than after.
+	if count > uint64(buf.Len()) {
+		return 0, 0, fmt.Errorf("database: checkpoint bundle claims %d entries, more than the %d bytes remaining", count, buf.Len())
+	}
+
+	type bundleEntry struct {
+		height int64
+		hash   string
+	}
+	entries := make([]bundleEntry, 0, count)
+	for i := uint64(0); i < count; i++ {
+		height, err := binary.ReadUvarint(buf)
+		if err != nil {
+			return 0, 0, err
+		}
+		hashLen, err := binary.ReadUvarint(buf)
+		if err != nil {
+			return 0, 0, err
+		}
+		if hashLen > uint64(buf.Len()) {
+			return 0, 0, fmt.Errorf("database: checkpoint bundle entry claims a %d-byte hash, more than the %d bytes remaining", hashLen, buf.Len())
+		}
+		hashBytes := make([]byte, hashLen)
+		if _, err := io.ReadFull(buf, hashBytes); err != nil {
+			return 0, 0, err
+		}
+		entries = append(entries, bundleEntry{height: int64(height), hash: string(hashBytes)})
+	}
+
+	bodyLen := len(data) - buf.Len()
+	body := data[:bodyLen]
+
+	sigLen, err := binary.ReadUvarint(buf)
+	if err != nil {
+		return 0, 0, err
+	}
+	if sigLen > uint64(buf.Len()) {
+		return 0, 0, fmt.Errorf("database: checkpoint bundle claims a %d-byte signature, more than the %d bytes remaining", sigLen, buf.Len())
+	}
+	sigBytes := make([]byte, sigLen)
+	if _, err := io.ReadFull(buf, sigBytes); err != nil {
+		return 0, 0, err
+	}
+
+	sig, err := btcec.ParseSignature(sigBytes, btcec.S256())
+	if err != nil {
+		return 0, 0, fmt.Errorf("database: parse checkpoint bundle signature: %v", err)
+	}
+
+	digest := chainhash.DoubleHashB(body)
+	verified := false
+	for _, raw := range trustedPubKeys {
+		pubKey, err := btcec.ParsePubKey(raw, btcec.S256())
+		if err != nil {
+			continue
+		}
+		if sig.Verify(digest, pubKey) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return 0, 0, errors.New("database: checkpoint bundle signature does not match any trusted key")
+	}
+
+	seen := uc.List(0, 0)
+	tx := uc.BeginTx()
+	for _, e := range entries {
+		if prevHash, ok := seen[e.height]; ok {
+			if prevHash == e.hash {
+				skipped++
+				continue
+			}
+			tx.Rollback()
+			return 0, 0, fmt.Errorf("database: checkpoint bundle conflicts with existing checkpoint at height %d", e.height)
+		}
+		seen[e.height] = e.hash
+		tx.Set([]byte(fmt.Sprintf("%020d", e.height)), []byte(e.hash))
+		added++
+	}
+
+	if added == 0 {
+		tx.Rollback()
+		return added, skipped, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return added, skipped, nil
+}
+
+// writeUvarint appends v to buf as a varint.
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	buf.Write(b[:n])
+}
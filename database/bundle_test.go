@@ -0,0 +1,171 @@
+package database
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/wakiyamap/monad/btcec"
+)
+
+func newTestSigningKey(t *testing.T) *btcec.PrivateKey {
+	t.Helper()
+	key, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("NewPrivateKey: %v", err)
+	}
+	return key
+}
+
+// TestBundleRoundTrip covers ExportBundle/ImportBundle's signature
+// verification and merge logic: a bundle signed by a trusted key imports
+// cleanly, one signed by an untrusted key is rejected, duplicate entries
+// are skipped, conflicting entries are rejected, and truncated/overlong
+// length fields are rejected rather than driving a bad allocation.
+func TestBundleRoundTrip(t *testing.T) {
+	t.Run("imports against a matching trusted key", func(t *testing.T) {
+		signingKey := newTestSigningKey(t)
+
+		src := NewUserCheckpoint(Config{DbType: "memory"})
+		if err := src.OpenDB(); err != nil {
+			t.Fatalf("OpenDB: %v", err)
+		}
+		defer src.CloseDB()
+		src.Add(100, "hash-100")
+		src.Add(200, "hash-200")
+
+		var buf bytes.Buffer
+		if err := src.ExportBundle(&buf, signingKey); err != nil {
+			t.Fatalf("ExportBundle: %v", err)
+		}
+
+		dst := NewUserCheckpoint(Config{DbType: "memory"})
+		if err := dst.OpenDB(); err != nil {
+			t.Fatalf("OpenDB: %v", err)
+		}
+		defer dst.CloseDB()
+
+		trusted := [][]byte{signingKey.PubKey().SerializeCompressed()}
+		added, skipped, err := dst.ImportBundle(bytes.NewReader(buf.Bytes()), trusted)
+		if err != nil {
+			t.Fatalf("ImportBundle: %v", err)
+		}
+		if added != 2 || skipped != 0 {
+			t.Fatalf("ImportBundle() = (%d, %d), want (2, 0)", added, skipped)
+		}
+
+		got := dst.List(0, 0)
+		if got[100] != "hash-100" || got[200] != "hash-200" {
+			t.Fatalf("List() = %v, want {100: hash-100, 200: hash-200}", got)
+		}
+	})
+
+	t.Run("rejects a signature from an untrusted key", func(t *testing.T) {
+		signingKey := newTestSigningKey(t)
+		untrustedKey := newTestSigningKey(t)
+
+		src := NewUserCheckpoint(Config{DbType: "memory"})
+		if err := src.OpenDB(); err != nil {
+			t.Fatalf("OpenDB: %v", err)
+		}
+		defer src.CloseDB()
+		src.Add(100, "hash-100")
+
+		var buf bytes.Buffer
+		if err := src.ExportBundle(&buf, signingKey); err != nil {
+			t.Fatalf("ExportBundle: %v", err)
+		}
+
+		dst := NewUserCheckpoint(Config{DbType: "memory"})
+		if err := dst.OpenDB(); err != nil {
+			t.Fatalf("OpenDB: %v", err)
+		}
+		defer dst.CloseDB()
+
+		trusted := [][]byte{untrustedKey.PubKey().SerializeCompressed()}
+		if _, _, err := dst.ImportBundle(bytes.NewReader(buf.Bytes()), trusted); err == nil {
+			t.Fatal("ImportBundle() = nil error, want rejection of an untrusted signature")
+		}
+		if got := dst.List(0, 0); len(got) != 0 {
+			t.Fatalf("List() = %v after rejected import, want empty", got)
+		}
+	})
+
+	t.Run("skips duplicates and rejects conflicts", func(t *testing.T) {
+		signingKey := newTestSigningKey(t)
+		trusted := [][]byte{signingKey.PubKey().SerializeCompressed()}
+
+		src := NewUserCheckpoint(Config{DbType: "memory"})
+		if err := src.OpenDB(); err != nil {
+			t.Fatalf("OpenDB: %v", err)
+		}
+		defer src.CloseDB()
+		src.Add(100, "hash-100")
+
+		var buf bytes.Buffer
+		if err := src.ExportBundle(&buf, signingKey); err != nil {
+			t.Fatalf("ExportBundle: %v", err)
+		}
+
+		dst := NewUserCheckpoint(Config{DbType: "memory"})
+		if err := dst.OpenDB(); err != nil {
+			t.Fatalf("OpenDB: %v", err)
+		}
+		defer dst.CloseDB()
+
+		// Same entry, matching hash: skipped.
+		dst.Add(100, "hash-100")
+		added, skipped, err := dst.ImportBundle(bytes.NewReader(buf.Bytes()), trusted)
+		if err != nil {
+			t.Fatalf("ImportBundle: %v", err)
+		}
+		if added != 0 || skipped != 1 {
+			t.Fatalf("ImportBundle() = (%d, %d), want (0, 1)", added, skipped)
+		}
+
+		// Same height, different hash: rejected, store untouched.
+		conflict := NewUserCheckpoint(Config{DbType: "memory"})
+		if err := conflict.OpenDB(); err != nil {
+			t.Fatalf("OpenDB: %v", err)
+		}
+		defer conflict.CloseDB()
+		conflict.Add(100, "a-different-hash")
+
+		if _, _, err := conflict.ImportBundle(bytes.NewReader(buf.Bytes()), trusted); err == nil {
+			t.Fatal("ImportBundle() = nil error, want conflicting-height rejection")
+		}
+		if got := conflict.List(0, 0)[100]; got != "a-different-hash" {
+			t.Fatalf("List()[100] = %q after rejected import, want untouched %q", got, "a-different-hash")
+		}
+	})
+
+	t.Run("rejects a truncated signature length", func(t *testing.T) {
+		signingKey := newTestSigningKey(t)
+		trusted := [][]byte{signingKey.PubKey().SerializeCompressed()}
+
+		src := NewUserCheckpoint(Config{DbType: "memory"})
+		if err := src.OpenDB(); err != nil {
+			t.Fatalf("OpenDB: %v", err)
+		}
+		defer src.CloseDB()
+		src.Add(100, "hash-100")
+
+		var buf bytes.Buffer
+		if err := src.ExportBundle(&buf, signingKey); err != nil {
+			t.Fatalf("ExportBundle: %v", err)
+		}
+
+		// Chop off the tail of the signature. The varint sigLen it read
+		// still claims the original length, now bigger than what's left.
+		truncated := buf.Bytes()[:buf.Len()-4]
+
+		dst := NewUserCheckpoint(Config{DbType: "memory"})
+		if err := dst.OpenDB(); err != nil {
+			t.Fatalf("OpenDB: %v", err)
+		}
+		defer dst.CloseDB()
+
+		if _, _, err := dst.ImportBundle(bytes.NewReader(truncated), trusted); err == nil {
+			t.Fatal("ImportBundle() = nil error, want rejection of a truncated signature")
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package database
+
+import "sync"
+
+// KVObject is implemented by values that participate in the read-through
+// cache in front of the stores in this package. Writes are routed through
+// it rather than raw key/value pairs so a future cached object can carry
+// its own SetValue behavior (e.g. merging) without changing cache's API.
+type KVObject interface {
+	Key() []byte
+	Value() []byte
+	SetValue([]byte)
+}
+
+// entry is the default KVObject: a plain key/value pair.
+type entry struct {
+	key   []byte
+	value []byte
+}
+
+func newEntry(key, value []byte) *entry {
+	return &entry{key: key, value: append([]byte(nil), value...)}
+}
+
+func (e *entry) Key() []byte { return e.key }
+
+func (e *entry) Value() []byte { return e.value }
+
+func (e *entry) SetValue(v []byte) { e.value = append([]byte(nil), v...) }
+
+// cache is a lazily-populated read-through cache owned by a single store
+// instance (UserCheckpoint, VolatileCheckpoint, AlertKey, or DenyAddress).
+// Entries are still keyed by store prefix rather than hard-coded to one
+// store, since Tx shares a cache with the store it was started from and
+// needs the prefix to address it.
+type cache struct {
+	mu     sync.Mutex
+	stores map[string]map[string][]byte
+}
+
+func newCache() *cache {
+	return &cache{stores: make(map[string]map[string][]byte)}
+}
+
+func (c *cache) get(prefix string, key []byte) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	store, ok := c.stores[prefix]
+	if !ok {
+		return nil, false
+	}
+	v, ok := store[string(key)]
+	return v, ok
+}
+
+func (c *cache) set(prefix string, obj KVObject) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	store, ok := c.stores[prefix]
+	if !ok {
+		store = make(map[string][]byte)
+		c.stores[prefix] = store
+	}
+	store[string(obj.Key())] = append([]byte(nil), obj.Value()...)
+}
+
+func (c *cache) delete(prefix string, key []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if store, ok := c.stores[prefix]; ok {
+		delete(store, string(key))
+	}
+}
+
+func (c *cache) clear(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.stores, prefix)
+}
@@ -1,15 +1,15 @@
 package database
 
 import (
-	"flag"
 	"fmt"
+	flags "github.com/jessevdk/go-flags"
+	"os"
 	"path/filepath"
 	"strconv"
 	"sync"
-	"time"
 
-	"github.com/btcsuite/goleveldb/leveldb"
 	"github.com/wakiyamap/monad/chaincfg"
+	"github.com/wakiyamap/monad/database/driver"
 	"github.com/wakiyamap/monad/wire"
 	"github.com/wakiyamap/monautil"
 )
@@ -27,24 +27,158 @@ const (
 	// DenyAddressDbNamePrefix is the prefix for the monad denyaddress database.
 	denyAddressDbNamePrefix = "denyaddress"
 
+	// defaultDbType is used when monad.conf does not set dbtype.
 	defaultDbType = "leveldb"
 )
 
 var (
-	monadHomeDir    = monautil.AppDataDir("monad", false)
-	defaultDataDir  = filepath.Join(monadHomeDir, "data")
-	activeNetParams = &chaincfg.MainNetParams
-	testnet         = flag.Bool("testnet", false, "operate on the testnet Bitcoin network")
-	regtest         = flag.Bool("regtest", false, "operate on the regtest Bitcoin network")
-	simnet          = flag.Bool("simnet", false, "operate on the simnet Bitcoin network")
+	monadHomeDir      = monautil.AppDataDir("monad", false)
+	defaultDataDir    = filepath.Join(monadHomeDir, "data")
+	defaultConfigFile = filepath.Join(monadHomeDir, "monad.conf")
+
+	globalCfgMu  sync.Mutex
+	globalCfg    Config
+	globalCfgSet bool
 )
 
-type UserCheckpoint struct {
-	Ucdb *leveldb.DB
+// Config carries everything a store needs to resolve its on-disk path and
+// backend. Building one never reads monad.conf or parses the command line,
+// which is what makes NewUserCheckpoint (and friends) safe to call from a
+// library embedder or a test with its own flag set.
+type Config struct {
+	// DataDir is the monad data directory. Empty means defaultDataDir.
+	DataDir string
+
+	// Net selects the network-specific subdirectory and chain params.
+	// The zero value resolves to chaincfg.MainNetParams.
+	Net wire.BitcoinNet
+
+	// DbType selects the driver.DB backend. Empty means defaultDbType.
+	DbType string
 }
 
-var instance *UserCheckpoint
-var once sync.Once
+// iniConfig mirrors monad.conf and the command line for loadConfig's use.
+// It is kept separate from Config so building a Config never depends on
+// go-flags or the filesystem.
+type iniConfig struct {
+	DataDir        string `short:"b" long:"datadir" description:"Location of the monad data directory"`
+	ConfigFile     string `short:"C" long:"configfile" description:"Path to configuration file"`
+	TestNet4       bool   `long:"testnet" description:"Use the test network"`
+	RegressionTest bool   `long:"regtest" description:"Use the regression test network"`
+	SimNet         bool   `long:"simnet" description:"Use the simulation test network"`
+	DbType         string `long:"dbtype" description:"Database backend to use (leveldb, boltdb, memory)"`
+}
+
+// SetGlobalConfig overrides the Config that GetUserCheckpointDbInstance and
+// its siblings build their singleton from the first time each is called.
+// It must be called before any of those functions for the override to take
+// effect; tests and embedders that don't want monad.conf parsed for them
+// should call it with an explicit Config, typically one with
+// DbType: "memory".
+func SetGlobalConfig(cfg Config) {
+	globalCfgMu.Lock()
+	defer globalCfgMu.Unlock()
+	globalCfg = cfg
+	globalCfgSet = true
+}
+
+// defaultGlobalConfig returns the Config the Get*DbInstance functions fall
+// back to when SetGlobalConfig hasn't been called, parsing monad.conf and
+// the command line exactly once.
+func defaultGlobalConfig() Config {
+	globalCfgMu.Lock()
+	defer globalCfgMu.Unlock()
+	if globalCfgSet {
+		return globalCfg
+	}
+
+	ini, _, err := loadConfig()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	net := chaincfg.MainNetParams.Net
+	if ini.TestNet4 {
+		net = chaincfg.TestNet4Params.Net
+	}
+	if ini.RegressionTest {
+		net = chaincfg.RegressionNetParams.Net
+	}
+	if ini.SimNet {
+		net = chaincfg.SimNetParams.Net
+	}
+
+	globalCfg = Config{DataDir: ini.DataDir, Net: net, DbType: ini.DbType}
+	globalCfgSet = true
+	return globalCfg
+}
+
+// loadConfig initializes and parses the config using a config file and
+// command line options, reading dbtype (and the active network) from
+// monad.conf the way the checkpoint package's loadConfig does. Unlike that
+// one, it does not reject --testnet and --simnet given together.
+func loadConfig() (*iniConfig, []string, error) {
+	cfg := iniConfig{
+		ConfigFile: defaultConfigFile,
+		DbType:     defaultDbType,
+	}
+
+	parser := flags.NewParser(&cfg, flags.Default)
+	preCfg := cfg
+	_ = flags.NewIniParser(parser).ParseFile(preCfg.ConfigFile)
+	remainingArgs, err := parser.Parse()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.DbType == "" {
+		cfg.DbType = defaultDbType
+	}
+
+	return &cfg, remainingArgs, nil
+}
+
+// paramsForNet maps a Config's Net back to the matching chaincfg.Params,
+// defaulting to mainnet for the zero value or an unrecognized network.
+func paramsForNet(net wire.BitcoinNet) *chaincfg.Params {
+	switch net {
+	case chaincfg.TestNet4Params.Net:
+		return &chaincfg.TestNet4Params
+	case chaincfg.RegressionNetParams.Net:
+		return &chaincfg.RegressionNetParams
+	case chaincfg.SimNetParams.Net:
+		return &chaincfg.SimNetParams
+	default:
+		return &chaincfg.MainNetParams
+	}
+}
+
+// dbTypeOrDefault returns cfg.DbType, falling back to defaultDbType.
+func dbTypeOrDefault(cfg Config) string {
+	if cfg.DbType == "" {
+		return defaultDbType
+	}
+	return cfg.DbType
+}
+
+// resolveDbPath builds the on-disk path for a store identified by prefix
+// under cfg.
+func resolveDbPath(cfg Config, prefix string) string {
+	dataDir := cfg.DataDir
+	if dataDir == "" {
+		dataDir = defaultDataDir
+	}
+	dbName := prefix + "_" + dbTypeOrDefault(cfg)
+	return filepath.Join(dataDir, netName(paramsForNet(cfg.Net)), dbName)
+}
+
+// ResolveDbPath builds the on-disk path for a store identified by prefix,
+// using the process-wide default Config (see SetGlobalConfig). It
+// centralizes the path logic that used to be duplicated across every
+// Get*DbPath function.
+func ResolveDbPath(prefix string) string {
+	return resolveDbPath(defaultGlobalConfig(), prefix)
+}
 
 // netName returns the name used when referring to a bitcoin network.  At the
 // time of writing, monad currently places blocks for testnet version 3 in the
@@ -64,6 +198,29 @@ func netName(chainParams *chaincfg.Params) string {
 	}
 }
 
+type UserCheckpoint struct {
+	Ucdb  driver.DB
+	mu    sync.Mutex
+	cfg   Config
+	cache *cache
+}
+
+var instance *UserCheckpoint
+var once sync.Once
+
+// maxHeightCacheKey caches the result of GetMaxCheckpointHeight under a key
+// that can't collide with a zero-padded height (those are all decimal
+// digits).
+var maxHeightCacheKey = []byte("\x00max")
+
+// NewUserCheckpoint builds a UserCheckpoint rooted at cfg, with its own
+// cache so two independently constructed instances (as tests pass in with
+// the in-memory driver) never see each other's entries. Call OpenDB before
+// using it.
+func NewUserCheckpoint(cfg Config) *UserCheckpoint {
+	return &UserCheckpoint{cfg: cfg, cache: newCache()}
+}
+
 // open usercheckpointDB. Basically it is called only at startup.
 func (uc *UserCheckpoint) OpenDB() error {
 	if uc.Ucdb != nil {
@@ -71,8 +228,7 @@ func (uc *UserCheckpoint) OpenDB() error {
 	}
 
 	var err error
-	dbpath := GetUserCheckpointDbPath()
-	uc.Ucdb, err = leveldb.OpenFile(dbpath, nil)
+	uc.Ucdb, err = driver.Open(dbTypeOrDefault(uc.cfg), resolveDbPath(uc.cfg, userCheckpointDbNamePrefix))
 	return err
 }
 
@@ -86,59 +242,106 @@ func (uc *UserCheckpoint) CloseDB() {
 }
 
 func (uc *UserCheckpoint) Add(height int64, hash string) {
-	_ = uc.Ucdb.Put([]byte(fmt.Sprintf("%020d", height)), []byte(hash), nil)
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	key := []byte(fmt.Sprintf("%020d", height))
+	value := []byte(hash)
+	_ = uc.Ucdb.Put(key, value)
+	uc.cache.set(userCheckpointDbNamePrefix, newEntry(key, value))
+	uc.cache.delete(userCheckpointDbNamePrefix, maxHeightCacheKey)
 }
 
 func (uc *UserCheckpoint) Delete(height int64) {
-	_ = uc.Ucdb.Delete([]byte(fmt.Sprintf("%020d", height)), nil)
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	key := []byte(fmt.Sprintf("%020d", height))
+	_ = uc.Ucdb.Delete(key)
+	uc.cache.delete(userCheckpointDbNamePrefix, key)
+	uc.cache.delete(userCheckpointDbNamePrefix, maxHeightCacheKey)
 }
 
 func (uc *UserCheckpoint) GetMaxCheckpointHeight() (height int64) {
-	height = 0
-	iter := uc.Ucdb.NewIterator(nil, nil)
-	iter.Last()
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
 
-	if !iter.Valid() {
+	if cached, ok := uc.cache.get(userCheckpointDbNamePrefix, maxHeightCacheKey); ok {
+		height, _ = strconv.ParseInt(string(cached), 10, 64)
 		return height
 	}
 
-	height, _ = strconv.ParseInt(string(iter.Key()), 10, 64)
-	iter.Release()
+	height = 0
+	iter := uc.Ucdb.Iterator(nil)
+	defer iter.Release()
+
+	var lastKey []byte
+	for iter.Next() {
+		lastKey = iter.Key()
+	}
+	if lastKey != nil {
+		height, _ = strconv.ParseInt(string(lastKey), 10, 64)
+	}
+
+	uc.cache.set(userCheckpointDbNamePrefix, newEntry(maxHeightCacheKey, []byte(strconv.FormatInt(height, 10))))
 	return height
 }
 
+// List returns every (height, hash) checkpoint with from <= height <= to.
+// A to of 0 means no upper bound.
+func (uc *UserCheckpoint) List(from, to int64) map[int64]string {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	iter := uc.Ucdb.Iterator(nil)
+	defer iter.Release()
+
+	result := make(map[int64]string)
+	for iter.Next() {
+		height, err := strconv.ParseInt(string(iter.Key()), 10, 64)
+		if err != nil {
+			continue
+		}
+		if height < from || (to > 0 && height > to) {
+			continue
+		}
+		result[height] = string(iter.Value())
+	}
+	return result
+}
+
+// BeginTx starts a transaction against Ucdb. Staged Set/Delete calls are
+// applied atomically on Commit; Rollback restores the keys the Tx touched.
+// It holds Ucdb's lock until the returned Tx's Commit or Rollback is
+// called, so at least one of them must always be called.
+func (uc *UserCheckpoint) BeginTx() *Tx {
+	return newTx(uc.Ucdb, userCheckpointDbNamePrefix, uc.cache, &uc.mu)
+}
+
 func GetUserCheckpointDbInstance() *UserCheckpoint {
 	once.Do(func() {
-		time.Sleep(1 * time.Second)
-		instance = &UserCheckpoint{nil}
+		instance = NewUserCheckpoint(defaultGlobalConfig())
 	})
 	return instance
 }
 
-func GetUserCheckpointDbPath() (dbPath string) {
-	flag.Parse()
-	if *testnet {
-		activeNetParams = &chaincfg.TestNet4Params
-	}
-	if *regtest {
-		activeNetParams = &chaincfg.RegressionNetParams
-	}
-	if *simnet {
-		activeNetParams = &chaincfg.SimNetParams
-	}
-	dbName := userCheckpointDbNamePrefix + "_" + defaultDbType
-	dbPath = filepath.Join(defaultDataDir, netName(activeNetParams), dbName)
-
-	return dbPath
-}
-
 type VolatileCheckpoint struct {
-	Vcdb *leveldb.DB
+	Vcdb  driver.DB
+	mu    sync.Mutex
+	cfg   Config
+	cache *cache
 }
 
 var vinstance *VolatileCheckpoint
 var vonce sync.Once
 
+// NewVolatileCheckpoint builds a VolatileCheckpoint rooted at cfg, with its
+// own cache so independently constructed instances never see each other's
+// entries. Call OpenDB before using it.
+func NewVolatileCheckpoint(cfg Config) *VolatileCheckpoint {
+	return &VolatileCheckpoint{cfg: cfg, cache: newCache()}
+}
+
 // open volatilecheckpointDB. Basically it is called only at startup.
 func (vc *VolatileCheckpoint) OpenDB() error {
 	if vc.Vcdb != nil {
@@ -146,8 +349,7 @@ func (vc *VolatileCheckpoint) OpenDB() error {
 	}
 
 	var err error
-	dbpath := GetVolatileCheckpointDbPath()
-	vc.Vcdb, err = leveldb.OpenFile(dbpath, nil)
+	vc.Vcdb, err = driver.Open(dbTypeOrDefault(vc.cfg), resolveDbPath(vc.cfg, volatileCheckpointDbNamePrefix))
 	return err
 }
 
@@ -161,59 +363,73 @@ func (vc *VolatileCheckpoint) CloseDB() {
 }
 
 func (vc *VolatileCheckpoint) Set(height int64, hash string) {
-	_ = vc.Vcdb.Put([]byte(fmt.Sprintf("%020d", height)), []byte(hash), nil)
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	key := []byte(fmt.Sprintf("%020d", height))
+	value := []byte(hash)
+	_ = vc.Vcdb.Put(key, value)
+	vc.cache.set(volatileCheckpointDbNamePrefix, newEntry(key, value))
 }
 
+// ClearDB deletes every key in Vcdb as a single atomic batch, so a partial
+// failure can no longer leave the store half-cleared the way a one-key-at-a-
+// time loop did.
 func (vc *VolatileCheckpoint) ClearDB() {
-	iter := vc.Vcdb.NewIterator(nil, nil)
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	iter := vc.Vcdb.Iterator(nil)
+	var keys []txOp
 	for iter.Next() {
-		err := vc.Vcdb.Delete([]byte(string(iter.Key())), nil)
-		if err != nil {
-			break
-		}
+		keys = append(keys, txOp{key: append([]byte(nil), iter.Key()...), delete: true})
 	}
 	iter.Release()
+
+	if err := writeOps(vc.Vcdb, keys); err != nil {
+		return
+	}
+	vc.cache.clear(volatileCheckpointDbNamePrefix)
+}
+
+// BeginTx starts a transaction against Vcdb. Staged Set/Delete calls are
+// applied atomically on Commit; Rollback restores the keys the Tx touched.
+// It holds Vcdb's lock until the returned Tx's Commit or Rollback is
+// called, so at least one of them must always be called.
+func (vc *VolatileCheckpoint) BeginTx() *Tx {
+	return newTx(vc.Vcdb, volatileCheckpointDbNamePrefix, vc.cache, &vc.mu)
 }
 
 func GetVolatileCheckpointDbInstance() *VolatileCheckpoint {
 	vonce.Do(func() {
-		time.Sleep(1 * time.Second)
-		vinstance = &VolatileCheckpoint{nil}
+		vinstance = NewVolatileCheckpoint(defaultGlobalConfig())
 	})
 	return vinstance
 }
 
-func GetVolatileCheckpointDbPath() (dbPath string) {
-	flag.Parse()
-	if *testnet {
-		activeNetParams = &chaincfg.TestNet4Params
-	}
-	if *regtest {
-		activeNetParams = &chaincfg.RegressionNetParams
-	}
-	if *simnet {
-		activeNetParams = &chaincfg.SimNetParams
-	}
-	dbName := volatileCheckpointDbNamePrefix + "_" + defaultDbType
-	dbPath = filepath.Join(defaultDataDir, netName(activeNetParams), dbName)
-
-	return dbPath
-}
-
 type AlertKey struct {
-	Akdb *leveldb.DB
+	Akdb  driver.DB
+	mu    sync.Mutex
+	cfg   Config
+	cache *cache
 }
 
 var ainstance *AlertKey
 var aonce sync.Once
 
+// NewAlertKey builds an AlertKey rooted at cfg, with its own cache so
+// independently constructed instances never see each other's entries. Call
+// OpenDB before using it.
+func NewAlertKey(cfg Config) *AlertKey {
+	return &AlertKey{cfg: cfg, cache: newCache()}
+}
+
 func (ak *AlertKey) OpenDB() error {
 	if ak.Akdb != nil {
 		return nil
 	}
 	var err error
-	dbpath := GetAlertKeyDbPath()
-	ak.Akdb, err = leveldb.OpenFile(dbpath, nil)
+	ak.Akdb, err = driver.Open(dbTypeOrDefault(ak.cfg), resolveDbPath(ak.cfg, alertKeyDbNamePrefix))
 	return err
 }
 
@@ -227,21 +443,24 @@ func (ak *AlertKey) CloseDB() {
 
 // Alertkey is disabled when you came here.irreversible.
 func (ak *AlertKey) Set(key string) {
-	_ = ak.Akdb.Put([]byte(key), []byte("true"), nil)
+	ak.mu.Lock()
+	defer ak.mu.Unlock()
+
+	k := []byte(key)
+	v := []byte("true")
+	_ = ak.Akdb.Put(k, v)
+	ak.cache.set(alertKeyDbNamePrefix, newEntry(k, v))
 }
 
 // Add alertkey if it is not in database.
 // Returns true if both of the public keys alertkey are OK.
 func (ak *AlertKey) IsValid() bool {
-	d1, err := ak.Akdb.Get(activeNetParams.AlertPubMainKey, nil)
-	if err != nil {
-		_ = ak.Akdb.Put(activeNetParams.AlertPubMainKey, []byte("false"), nil)
-	}
+	ak.mu.Lock()
+	defer ak.mu.Unlock()
 
-	d2, err := ak.Akdb.Get(activeNetParams.AlertPubSubKey, nil)
-	if err != nil {
-		_ = ak.Akdb.Put(activeNetParams.AlertPubSubKey, []byte("false"), nil)
-	}
+	netParams := paramsForNet(ak.cfg.Net)
+	d1 := ak.lookup(netParams.AlertPubMainKey)
+	d2 := ak.lookup(netParams.AlertPubSubKey)
 
 	if string(d1) == "false" && string(d2) == "false" {
 		return true
@@ -249,44 +468,57 @@ func (ak *AlertKey) IsValid() bool {
 	return false
 }
 
+// lookup returns the cached value for key, falling back to Akdb on a cache
+// miss. A key neither Akdb nor the cache has seen yet is persisted and
+// cached as "false" for next time, but this call itself still reports the
+// miss (a nil []byte, not "false") to the caller: IsValid relies on the
+// very first lookup against a fresh store coming back un-OK, with only the
+// second lookup onward reading back the now-persisted "false".
+func (ak *AlertKey) lookup(key []byte) []byte {
+	if v, ok := ak.cache.get(alertKeyDbNamePrefix, key); ok {
+		return v
+	}
+
+	v, err := ak.Akdb.Get(key)
+	if err != nil {
+		_ = ak.Akdb.Put(key, []byte("false"))
+		ak.cache.set(alertKeyDbNamePrefix, newEntry(key, []byte("false")))
+		return nil
+	}
+	ak.cache.set(alertKeyDbNamePrefix, newEntry(key, v))
+	return v
+}
+
 func GetAlertKeyDbInstance() *AlertKey {
 	aonce.Do(func() {
-		time.Sleep(1 * time.Second)
-		ainstance = &AlertKey{nil}
+		ainstance = NewAlertKey(defaultGlobalConfig())
 	})
 	return ainstance
 }
 
-func GetAlertKeyDbPath() (dbPath string) {
-	flag.Parse()
-	if *testnet {
-		activeNetParams = &chaincfg.TestNet4Params
-	}
-	if *regtest {
-		activeNetParams = &chaincfg.RegressionNetParams
-	}
-	if *simnet {
-		activeNetParams = &chaincfg.SimNetParams
-	}
-	dbName := alertKeyDbNamePrefix + "_" + defaultDbType
-	dbPath = filepath.Join(defaultDataDir, netName(activeNetParams), dbName)
-	return dbPath
-}
-
 type DenyAddress struct {
-	Dadb *leveldb.DB
+	Dadb  driver.DB
+	mu    sync.Mutex
+	cfg   Config
+	cache *cache
 }
 
 var dinstance *DenyAddress
 var donce sync.Once
 
+// NewDenyAddress builds a DenyAddress rooted at cfg, with its own cache so
+// independently constructed instances never see each other's entries. Call
+// OpenDB before using it.
+func NewDenyAddress(cfg Config) *DenyAddress {
+	return &DenyAddress{cfg: cfg, cache: newCache()}
+}
+
 func (da *DenyAddress) OpenDB() error {
 	if da.Dadb != nil {
 		return nil
 	}
 	var err error
-	dbpath := GetDenyAddressDbPath()
-	da.Dadb, err = leveldb.OpenFile(dbpath, nil)
+	da.Dadb, err = driver.Open(dbTypeOrDefault(da.cfg), resolveDbPath(da.cfg, denyAddressDbNamePrefix))
 	return err
 }
 
@@ -299,29 +531,43 @@ func (da *DenyAddress) CloseDB() {
 }
 
 func (da *DenyAddress) Set(address string) {
-	_ = da.Dadb.Put([]byte(address), []byte("0"), nil)
+	da.mu.Lock()
+	defer da.mu.Unlock()
+
+	key := []byte(address)
+	value := []byte("0")
+	_ = da.Dadb.Put(key, value)
+	da.cache.set(denyAddressDbNamePrefix, newEntry(key, value))
+}
+
+// Remove lifts a deny entry for address, if one exists.
+func (da *DenyAddress) Remove(address string) {
+	da.mu.Lock()
+	defer da.mu.Unlock()
+
+	key := []byte(address)
+	_ = da.Dadb.Delete(key)
+	da.cache.delete(denyAddressDbNamePrefix, key)
+}
+
+// List returns every address currently on the denylist.
+func (da *DenyAddress) List() []string {
+	da.mu.Lock()
+	defer da.mu.Unlock()
+
+	iter := da.Dadb.Iterator(nil)
+	defer iter.Release()
+
+	var addresses []string
+	for iter.Next() {
+		addresses = append(addresses, string(iter.Key()))
+	}
+	return addresses
 }
 
 func GetDenyAddressDbInstance() *DenyAddress {
 	donce.Do(func() {
-		time.Sleep(1 * time.Second)
-		dinstance = &DenyAddress{nil}
+		dinstance = NewDenyAddress(defaultGlobalConfig())
 	})
 	return dinstance
 }
-
-func GetDenyAddressDbPath() (dbPath string) {
-	flag.Parse()
-	if *testnet {
-		activeNetParams = &chaincfg.TestNet4Params
-	}
-	if *regtest {
-		activeNetParams = &chaincfg.RegressionNetParams
-	}
-	if *simnet {
-		activeNetParams = &chaincfg.SimNetParams
-	}
-	dbName := denyAddressDbNamePrefix + "_" + defaultDbType
-	dbPath = filepath.Join(defaultDataDir, netName(activeNetParams), dbName)
-	return dbPath
-}
\ No newline at end of file
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+// BenchmarkUserCheckpointGetMaxCheckpointHeightWarm measures
+// GetMaxCheckpointHeight throughput once the cache has been warmed and
+// nothing is invalidating it, the steady-state case the cache exists for.
+func BenchmarkUserCheckpointGetMaxCheckpointHeightWarm(b *testing.B) {
+	uc := NewUserCheckpoint(Config{DbType: "memory"})
+	if err := uc.OpenDB(); err != nil {
+		b.Fatalf("OpenDB: %v", err)
+	}
+	defer uc.CloseDB()
+
+	for h := int64(0); h < 1000; h++ {
+		uc.Add(h, "hash")
+	}
+	uc.GetMaxCheckpointHeight()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			uc.GetMaxCheckpointHeight()
+		}
+	})
+}
+
+// BenchmarkUserCheckpointAddGetMaxCheckpointHeightChurn measures the same
+// call under concurrent Add load, where every Add invalidates the cached
+// max height and forces GetMaxCheckpointHeight back to a full iterator
+// scan -- effectively the uncached case, since the cache never gets to
+// stay warm.
+func BenchmarkUserCheckpointAddGetMaxCheckpointHeightChurn(b *testing.B) {
+	uc := NewUserCheckpoint(Config{DbType: "memory"})
+	if err := uc.OpenDB(); err != nil {
+		b.Fatalf("OpenDB: %v", err)
+	}
+	defer uc.CloseDB()
+
+	var height int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			h := atomic.AddInt64(&height, 1)
+			uc.Add(h, "hash")
+			uc.GetMaxCheckpointHeight()
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestInstancesAreIsolated constructs several instances of each store type
+// in parallel, all using the in-memory driver, and checks that none of
+// them observe another instance's cached or persisted data. This is the
+// scenario NewUserCheckpoint/NewVolatileCheckpoint/NewAlertKey/
+// NewDenyAddress exist to support.
+func TestInstancesAreIsolated(t *testing.T) {
+	const instances = 8
+
+	t.Run("UserCheckpoint", func(t *testing.T) {
+		for i := 0; i < instances; i++ {
+			i := i
+			t.Run(fmt.Sprintf("instance-%d", i), func(t *testing.T) {
+				t.Parallel()
+
+				uc := NewUserCheckpoint(Config{DbType: "memory"})
+				if err := uc.OpenDB(); err != nil {
+					t.Fatalf("OpenDB: %v", err)
+				}
+				defer uc.CloseDB()
+
+				height := int64(100 + i)
+				hash := fmt.Sprintf("hash-%d", i)
+				uc.Add(height, hash)
+
+				if got := uc.GetMaxCheckpointHeight(); got != height {
+					t.Fatalf("GetMaxCheckpointHeight() = %d, want %d", got, height)
+				}
+				if got := uc.List(0, 0); len(got) != 1 || got[height] != hash {
+					t.Fatalf("List(0, 0) = %v, want {%d: %q}", got, height, hash)
+				}
+			})
+		}
+	})
+
+	t.Run("VolatileCheckpoint", func(t *testing.T) {
+		for i := 0; i < instances; i++ {
+			i := i
+			t.Run(fmt.Sprintf("instance-%d", i), func(t *testing.T) {
+				t.Parallel()
+
+				vc := NewVolatileCheckpoint(Config{DbType: "memory"})
+				if err := vc.OpenDB(); err != nil {
+					t.Fatalf("OpenDB: %v", err)
+				}
+				defer vc.CloseDB()
+
+				vc.Set(int64(i), fmt.Sprintf("hash-%d", i))
+
+				iter := vc.Vcdb.Iterator(nil)
+				n := 0
+				for iter.Next() {
+					n++
+				}
+				iter.Release()
+				if n != 1 {
+					t.Fatalf("Vcdb holds %d keys, want 1", n)
+				}
+			})
+		}
+	})
+
+	t.Run("AlertKey", func(t *testing.T) {
+		for i := 0; i < instances; i++ {
+			i := i
+			t.Run(fmt.Sprintf("instance-%d", i), func(t *testing.T) {
+				t.Parallel()
+
+				ak := NewAlertKey(Config{DbType: "memory"})
+				if err := ak.OpenDB(); err != nil {
+					t.Fatalf("OpenDB: %v", err)
+				}
+				defer ak.CloseDB()
+
+				if got := ak.IsValid(); got {
+					t.Fatalf("IsValid() = true on a fresh store, want false")
+				}
+			})
+		}
+	})
+
+	t.Run("DenyAddress", func(t *testing.T) {
+		for i := 0; i < instances; i++ {
+			i := i
+			t.Run(fmt.Sprintf("instance-%d", i), func(t *testing.T) {
+				t.Parallel()
+
+				da := NewDenyAddress(Config{DbType: "memory"})
+				if err := da.OpenDB(); err != nil {
+					t.Fatalf("OpenDB: %v", err)
+				}
+				defer da.CloseDB()
+
+				address := fmt.Sprintf("addr-%d", i)
+				da.Set(address)
+
+				if got := da.List(); len(got) != 1 || got[0] != address {
+					t.Fatalf("List() = %v, want [%s]", got, address)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package driver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/boltdb/bolt"
+)
+
+func init() {
+	RegisterDriver("boltdb", openBoltDB)
+}
+
+// boltBucket is the single bucket every store keeps its keys in. BoltDB has
+// no notion of column families the way LevelDB does, so one bucket per
+// opened file is enough for the single-prefix stores this package backs.
+var boltBucket = []byte("monad")
+
+// boltDB adapts a single-file *bolt.DB to the driver.DB interface, following
+// the same small-keyed-store usage boltdb gets elsewhere (e.g. Podman and
+// libnetwork use it for exactly this kind of local metadata store).
+type boltDB struct {
+	db *bolt.DB
+}
+
+func openBoltDB(path string) (DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltDB{db: db}, nil
+}
+
+func (b *boltDB) Put(key, value []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put(key, value)
+	})
+}
+
+func (b *boltDB) Get(key []byte) (value []byte, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(boltBucket).Get(key)
+		if v == nil {
+			return ErrNotFound
+		}
+		value = append([]byte(nil), v...)
+		return nil
+	})
+	return value, err
+}
+
+func (b *boltDB) Delete(key []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete(key)
+	})
+}
+
+func (b *boltDB) Close() error {
+	return b.db.Close()
+}
+
+// NewBatch stages Put/Delete calls and applies them in a single bolt
+// read-write transaction when Write is called.
+func (b *boltDB) NewBatch() Batch {
+	return &boltBatch{db: b.db}
+}
+
+type boltBatch struct {
+	db  *bolt.DB
+	ops []func(*bolt.Tx) error
+}
+
+func (b *boltBatch) Put(key, value []byte) {
+	k := append([]byte(nil), key...)
+	v := append([]byte(nil), value...)
+	b.ops = append(b.ops, func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put(k, v)
+	})
+}
+
+func (b *boltBatch) Delete(key []byte) {
+	k := append([]byte(nil), key...)
+	b.ops = append(b.ops, func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete(k)
+	})
+}
+
+func (b *boltBatch) Write() error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		for _, op := range b.ops {
+			if err := op(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltDB) Iterator(prefix []byte) Iterator {
+	tx, err := b.db.Begin(false)
+	if err != nil {
+		return &boltIterator{err: err}
+	}
+	return &boltIterator{tx: tx, cursor: tx.Bucket(boltBucket).Cursor(), prefix: prefix, first: true}
+}
+
+// boltIterator walks a bolt cursor inside its own read-only transaction,
+// which must stay open for the lifetime of the iterator and is closed by
+// Release.
+type boltIterator struct {
+	tx     *bolt.Tx
+	cursor *bolt.Cursor
+	prefix []byte
+	first  bool
+	key    []byte
+	value  []byte
+	err    error
+}
+
+func (it *boltIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	var k, v []byte
+	if it.first {
+		it.first = false
+		if len(it.prefix) > 0 {
+			k, v = it.cursor.Seek(it.prefix)
+		} else {
+			k, v = it.cursor.First()
+		}
+	} else {
+		k, v = it.cursor.Next()
+	}
+
+	if k == nil || (len(it.prefix) > 0 && !bytes.HasPrefix(k, it.prefix)) {
+		it.key, it.value = nil, nil
+		return false
+	}
+	it.key = append([]byte(nil), k...)
+	it.value = append([]byte(nil), v...)
+	return true
+}
+
+func (it *boltIterator) Key() []byte {
+	return it.key
+}
+
+func (it *boltIterator) Value() []byte {
+	return it.value
+}
+
+func (it *boltIterator) Release() {
+	if it.tx != nil {
+		_ = it.tx.Rollback()
+	}
+}
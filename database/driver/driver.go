@@ -0,0 +1,107 @@
+// Package driver defines the pluggable storage interface used by the
+// database package's checkpoint and denylist stores, along with a registry
+// of named backends (modeled after the stdlib database/sql driver registry).
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNotFound is returned by DB.Get when the requested key does not exist.
+// Backends must translate their own not-found error into this value so
+// callers can rely on a single sentinel regardless of which driver is active.
+var ErrNotFound = errors.New("database/driver: key not found")
+
+// DB is the minimal key/value store every backend must implement. It covers
+// exactly the operations the checkpoint and denylist stores use today.
+type DB interface {
+	// Put writes value for key, overwriting any existing value.
+	Put(key, value []byte) error
+
+	// Get returns the value stored for key, or ErrNotFound if it is absent.
+	Get(key []byte) ([]byte, error)
+
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(key []byte) error
+
+	// Iterator returns an Iterator over all keys sharing prefix, in
+	// ascending key order. A nil or empty prefix iterates every key.
+	Iterator(prefix []byte) Iterator
+
+	// Close releases any resources held by the backend.
+	Close() error
+}
+
+// Iterator walks the keys of a DB in ascending order.
+type Iterator interface {
+	// Next advances the iterator and reports whether a key/value pair is
+	// available. It must be called once before the first Key/Value call.
+	Next() bool
+
+	// Key returns the key at the current position.
+	Key() []byte
+
+	// Value returns the value at the current position.
+	Value() []byte
+
+	// Release frees resources held by the iterator. It is safe to call
+	// Release without exhausting Next.
+	Release()
+}
+
+// Ctor constructs a DB backend rooted at path. path is whatever the backend
+// needs to locate its storage; on-disk backends treat it as a directory or
+// file path, in-memory backends ignore it.
+type Ctor func(path string) (DB, error)
+
+// Batch accumulates Put/Delete operations for atomic application via Write.
+// A Batch is not safe for concurrent use.
+type Batch interface {
+	Put(key, value []byte)
+	Delete(key []byte)
+
+	// Write applies every staged operation atomically: either all of them
+	// land, or none do.
+	Write() error
+}
+
+// Batcher is implemented by backends that can stage multiple Put/Delete
+// operations and apply them as a single atomic write.
+type Batcher interface {
+	NewBatch() Batch
+}
+
+var (
+	driversMu sync.Mutex
+	drivers   = make(map[string]Ctor)
+)
+
+// RegisterDriver makes a backend constructor available under name. It is
+// intended to be called from a backend package's init function and panics
+// if ctor is nil or name is already registered.
+func RegisterDriver(name string, ctor Ctor) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if ctor == nil {
+		panic("database/driver: RegisterDriver ctor is nil")
+	}
+	if _, dup := drivers[name]; dup {
+		panic("database/driver: RegisterDriver called twice for driver " + name)
+	}
+	drivers[name] = ctor
+}
+
+// Open opens the named backend rooted at path.
+func Open(name, path string) (DB, error) {
+	driversMu.Lock()
+	ctor, ok := drivers[name]
+	driversMu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("database/driver: unknown driver %q", name)
+	}
+	return ctor(path)
+}
@@ -0,0 +1,96 @@
+package driver
+
+import (
+	"github.com/btcsuite/goleveldb/leveldb"
+	"github.com/btcsuite/goleveldb/leveldb/iterator"
+	"github.com/btcsuite/goleveldb/leveldb/util"
+)
+
+func init() {
+	RegisterDriver("leveldb", openLevelDB)
+}
+
+// levelDB adapts *leveldb.DB to the driver.DB interface. This is the
+// original, default backend.
+type levelDB struct {
+	db *leveldb.DB
+}
+
+func openLevelDB(path string) (DB, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &levelDB{db: db}, nil
+}
+
+func (l *levelDB) Put(key, value []byte) error {
+	return l.db.Put(key, value, nil)
+}
+
+func (l *levelDB) Get(key []byte) ([]byte, error) {
+	value, err := l.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (l *levelDB) Delete(key []byte) error {
+	return l.db.Delete(key, nil)
+}
+
+func (l *levelDB) Close() error {
+	return l.db.Close()
+}
+
+// NewBatch stages Put/Delete calls into a *leveldb.Batch, applied
+// atomically by Write via the underlying DB's batched write.
+func (l *levelDB) NewBatch() Batch {
+	return &levelDBBatch{db: l.db, batch: new(leveldb.Batch)}
+}
+
+type levelDBBatch struct {
+	db    *leveldb.DB
+	batch *leveldb.Batch
+}
+
+func (b *levelDBBatch) Put(key, value []byte) {
+	b.batch.Put(key, value)
+}
+
+func (b *levelDBBatch) Delete(key []byte) {
+	b.batch.Delete(key)
+}
+
+func (b *levelDBBatch) Write() error {
+	return b.db.Write(b.batch, nil)
+}
+
+func (l *levelDB) Iterator(prefix []byte) Iterator {
+	var rng *util.Range
+	if len(prefix) > 0 {
+		rng = util.BytesPrefix(prefix)
+	}
+	return &levelDBIterator{iter: l.db.NewIterator(rng, nil)}
+}
+
+type levelDBIterator struct {
+	iter iterator.Iterator
+}
+
+func (i *levelDBIterator) Next() bool {
+	return i.iter.Next()
+}
+
+func (i *levelDBIterator) Key() []byte {
+	return i.iter.Key()
+}
+
+func (i *levelDBIterator) Value() []byte {
+	return i.iter.Value()
+}
+
+func (i *levelDBIterator) Release() {
+	i.iter.Release()
+}
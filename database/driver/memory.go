@@ -0,0 +1,118 @@
+package driver
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+)
+
+func init() {
+	RegisterDriver("memory", openMemoryDB)
+}
+
+// memoryDB is a process-local, non-persistent backend intended for unit
+// tests that would otherwise need a real filesystem.
+type memoryDB struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+func openMemoryDB(_ string) (DB, error) {
+	return &memoryDB{data: make(map[string][]byte)}, nil
+}
+
+func (m *memoryDB) Put(key, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[string(key)] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m *memoryDB) Get(key []byte) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	v, ok := m.data[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return v, nil
+}
+
+func (m *memoryDB) Delete(key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, string(key))
+	return nil
+}
+
+func (m *memoryDB) Close() error {
+	return nil
+}
+
+// NewBatch stages Put/Delete calls and applies them under a single lock
+// acquisition when Write is called.
+func (m *memoryDB) NewBatch() Batch {
+	return &memoryBatch{db: m}
+}
+
+type memoryBatch struct {
+	db  *memoryDB
+	ops []func(map[string][]byte)
+}
+
+func (b *memoryBatch) Put(key, value []byte) {
+	k := string(key)
+	v := append([]byte(nil), value...)
+	b.ops = append(b.ops, func(data map[string][]byte) { data[k] = v })
+}
+
+func (b *memoryBatch) Delete(key []byte) {
+	k := string(key)
+	b.ops = append(b.ops, func(data map[string][]byte) { delete(data, k) })
+}
+
+func (b *memoryBatch) Write() error {
+	b.db.mu.Lock()
+	defer b.db.mu.Unlock()
+	for _, op := range b.ops {
+		op(b.db.data)
+	}
+	return nil
+}
+
+func (m *memoryDB) Iterator(prefix []byte) Iterator {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]string, 0, len(m.data))
+	for k := range m.data {
+		if bytes.HasPrefix([]byte(k), prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return &memoryIterator{db: m, keys: keys, pos: -1}
+}
+
+type memoryIterator struct {
+	db   *memoryDB
+	keys []string
+	pos  int
+}
+
+func (it *memoryIterator) Next() bool {
+	it.pos++
+	return it.pos < len(it.keys)
+}
+
+func (it *memoryIterator) Key() []byte {
+	return []byte(it.keys[it.pos])
+}
+
+func (it *memoryIterator) Value() []byte {
+	it.db.mu.RLock()
+	defer it.db.mu.RUnlock()
+	return it.db.data[it.keys[it.pos]]
+}
+
+func (it *memoryIterator) Release() {}
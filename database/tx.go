@@ -0,0 +1,187 @@
+package database
+
+import (
+	"sync"
+
+	"github.com/wakiyamap/monad/database/driver"
+)
+
+// snapshotEntry records the value a key held before a Tx first touched it,
+// so Rollback can restore it.
+type snapshotEntry struct {
+	value  []byte
+	exists bool
+}
+
+// txOp is a single staged Set or Delete.
+type txOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// Tx accumulates Set/Delete calls against one store and applies them
+// atomically on Commit, via the backend's Batch support when available.
+// Every key it touches is snapshotted first, so Rollback can restore the
+// store to its pre-Tx state whether that's instead of Commit or to undo an
+// already-committed Tx. This mirrors the snapshot -> mutate -> revert
+// pattern used for simulated/reverted state elsewhere.
+//
+// newTx takes the store's mutex for the whole build-up phase, so a
+// concurrent direct Add/Delete/Set on the same store can't interleave with
+// touch/Set/Delete and desync the snapshot from what Commit ultimately
+// applies. The lock is released when Commit or Rollback finishes, so at
+// least one of them must eventually be called or the store deadlocks.
+type Tx struct {
+	db     driver.DB
+	prefix string
+	cache  *cache
+	mu     *sync.Mutex
+	locked bool
+
+	snapshot map[string]snapshotEntry
+	ops      []txOp
+}
+
+func newTx(db driver.DB, prefix string, c *cache, mu *sync.Mutex) *Tx {
+	mu.Lock()
+	return &Tx{
+		db:       db,
+		prefix:   prefix,
+		cache:    c,
+		mu:       mu,
+		locked:   true,
+		snapshot: make(map[string]snapshotEntry),
+	}
+}
+
+// touch records the pre-Tx value of key the first time the Tx sees it.
+func (tx *Tx) touch(key []byte) {
+	k := string(key)
+	if _, ok := tx.snapshot[k]; ok {
+		return
+	}
+
+	if v, ok := tx.cache.get(tx.prefix, key); ok {
+		tx.snapshot[k] = snapshotEntry{value: v, exists: true}
+		return
+	}
+	v, err := tx.db.Get(key)
+	if err == nil {
+		tx.snapshot[k] = snapshotEntry{value: v, exists: true}
+	} else {
+		tx.snapshot[k] = snapshotEntry{exists: false}
+	}
+}
+
+// Set stages a Put for key within the transaction.
+func (tx *Tx) Set(key, value []byte) {
+	tx.touch(key)
+	tx.ops = append(tx.ops, txOp{key: key, value: value})
+}
+
+// Delete stages a Delete for key within the transaction.
+func (tx *Tx) Delete(key []byte) {
+	tx.touch(key)
+	tx.ops = append(tx.ops, txOp{key: key, delete: true})
+}
+
+// Commit applies every staged Set/Delete atomically. On error, the backing
+// store and cache are left untouched.
+func (tx *Tx) Commit() error {
+	if !tx.locked {
+		tx.mu.Lock()
+		tx.locked = true
+	}
+	defer func() {
+		tx.mu.Unlock()
+		tx.locked = false
+	}()
+
+	if err := writeOps(tx.db, tx.ops); err != nil {
+		return err
+	}
+	for _, op := range tx.ops {
+		if op.delete {
+			tx.cache.delete(tx.prefix, op.key)
+		} else {
+			tx.cache.set(tx.prefix, newEntry(op.key, op.value))
+		}
+	}
+	// A committed Set/Delete can change which key is the max height, so
+	// the cached sentinel GetMaxCheckpointHeight warms can no longer be
+	// trusted. This is a no-op for stores (like VolatileCheckpoint) that
+	// never populate maxHeightCacheKey.
+	tx.cache.delete(tx.prefix, maxHeightCacheKey)
+	return nil
+}
+
+// Rollback restores every key the Tx touched to the value it held before
+// the Tx began. It can be called instead of Commit to discard staged
+// changes, or after Commit to undo them.
+func (tx *Tx) Rollback() error {
+	if !tx.locked {
+		tx.mu.Lock()
+		tx.locked = true
+	}
+	defer func() {
+		tx.mu.Unlock()
+		tx.locked = false
+	}()
+
+	ops := make([]txOp, 0, len(tx.snapshot))
+	for k, entry := range tx.snapshot {
+		key := []byte(k)
+		if entry.exists {
+			ops = append(ops, txOp{key: key, value: entry.value})
+		} else {
+			ops = append(ops, txOp{key: key, delete: true})
+		}
+	}
+
+	if err := writeOps(tx.db, ops); err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if op.delete {
+			tx.cache.delete(tx.prefix, op.key)
+		} else {
+			tx.cache.set(tx.prefix, newEntry(op.key, op.value))
+		}
+	}
+	tx.cache.delete(tx.prefix, maxHeightCacheKey)
+	return nil
+}
+
+// writeOps applies ops atomically via driver.Batcher when the backend
+// supports it, falling back to sequential writes otherwise.
+func writeOps(db driver.DB, ops []txOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+
+	if batcher, ok := db.(driver.Batcher); ok {
+		batch := batcher.NewBatch()
+		for _, op := range ops {
+			if op.delete {
+				batch.Delete(op.key)
+			} else {
+				batch.Put(op.key, op.value)
+			}
+		}
+		return batch.Write()
+	}
+
+	for _, op := range ops {
+		var err error
+		if op.delete {
+			err = db.Delete(op.key)
+		} else {
+			err = db.Put(op.key, op.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+)
+
+func checkpointKey(height int64) []byte {
+	return []byte(fmt.Sprintf("%020d", height))
+}
+
+// TestTxCommitRollback covers the atomicity guarantee BeginTx's doc comment
+// promises: a Tx either fully applies on Commit, or Rollback returns the
+// store to its state from before the Tx began -- whether Rollback is called
+// instead of Commit or after it.
+func TestTxCommitRollback(t *testing.T) {
+	t.Run("commit applies every staged Set and Delete", func(t *testing.T) {
+		uc := NewUserCheckpoint(Config{DbType: "memory"})
+		if err := uc.OpenDB(); err != nil {
+			t.Fatalf("OpenDB: %v", err)
+		}
+		defer uc.CloseDB()
+
+		uc.Add(100, "pre-existing")
+
+		tx := uc.BeginTx()
+		tx.Set(checkpointKey(200), []byte("new"))
+		tx.Delete(checkpointKey(100))
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit: %v", err)
+		}
+
+		got := uc.List(0, 0)
+		if _, ok := got[100]; ok {
+			t.Fatalf("List() = %v, still has height 100 after Commit deleted it", got)
+		}
+		if got[200] != "new" {
+			t.Fatalf("List()[200] = %q, want %q", got[200], "new")
+		}
+	})
+
+	t.Run("rollback restores the value a Set staged over", func(t *testing.T) {
+		uc := NewUserCheckpoint(Config{DbType: "memory"})
+		if err := uc.OpenDB(); err != nil {
+			t.Fatalf("OpenDB: %v", err)
+		}
+		defer uc.CloseDB()
+
+		uc.Add(100, "original")
+
+		tx := uc.BeginTx()
+		tx.Set(checkpointKey(100), []byte("overwritten"))
+		tx.Set(checkpointKey(300), []byte("new"))
+		if err := tx.Rollback(); err != nil {
+			t.Fatalf("Rollback: %v", err)
+		}
+
+		got := uc.List(0, 0)
+		if got[100] != "original" {
+			t.Fatalf("List()[100] = %q after Rollback, want %q", got[100], "original")
+		}
+		if _, ok := got[300]; ok {
+			t.Fatalf("List() = %v, still has height 300 after Rollback discarded it", got)
+		}
+	})
+
+	t.Run("rollback after commit undoes it", func(t *testing.T) {
+		uc := NewUserCheckpoint(Config{DbType: "memory"})
+		if err := uc.OpenDB(); err != nil {
+			t.Fatalf("OpenDB: %v", err)
+		}
+		defer uc.CloseDB()
+
+		uc.Add(100, "original")
+
+		tx := uc.BeginTx()
+		tx.Set(checkpointKey(100), []byte("overwritten"))
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit: %v", err)
+		}
+		if got := uc.List(0, 0)[100]; got != "overwritten" {
+			t.Fatalf("List()[100] = %q after Commit, want %q", got, "overwritten")
+		}
+
+		if err := tx.Rollback(); err != nil {
+			t.Fatalf("Rollback: %v", err)
+		}
+		if got := uc.List(0, 0)[100]; got != "original" {
+			t.Fatalf("List()[100] = %q after rollback-after-commit, want %q", got, "original")
+		}
+	})
+}